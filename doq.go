@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// doqALPN is the ALPN token for DNS-over-QUIC, per RFC 9250.
+const doqALPN = "doq"
+
+// doqSession wraps a single QUIC connection to a DoQ resolver. A session is
+// opened once per run and reused across qtypes, opening a fresh
+// bidirectional stream for each query as required by RFC 9250.
+type doqSession struct {
+	conn    *quic.Conn
+	timeout time.Duration
+}
+
+// newDoQSession dials addr (a quic:// or doq:// URL) and establishes a QUIC
+// session ready to carry DNS queries.
+func newDoQSession(addr string, insecure bool, timeout time.Duration) (*doqSession, error) {
+	host := strings.TrimPrefix(strings.TrimPrefix(addr, "quic://"), "doq://")
+	if !strings.Contains(host, ":") {
+		host += ":853"
+	}
+
+	tlsConf := &tls.Config{
+		InsecureSkipVerify: insecure,
+		NextProtos:         []string{doqALPN},
+		ServerName:         strings.Split(host, ":")[0],
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := quic.DialAddr(ctx, host, tlsConf, nil)
+	if err != nil {
+		return nil, fmt.Errorf("doq handshake: %w", err)
+	}
+
+	return &doqSession{conn: conn, timeout: timeout}, nil
+}
+
+// exchange sends req on a new stream and returns the parsed reply, per the
+// length-prefixed DNS-over-QUIC wire format.
+func (s *doqSession) exchange(req *dns.Msg) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	stream, err := s.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("doq open stream: %w", err)
+	}
+	defer stream.Close()
+
+	// OpenStreamSync only honors ctx for opening the stream; the write and
+	// read below need their own deadlines or a peer that never answers
+	// would hang for up to the connection's (much longer) idle timeout
+	// rather than queryTimeout.
+	deadline := time.Now().Add(s.timeout)
+	if err := stream.SetWriteDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("doq set write deadline: %w", err)
+	}
+	if err := stream.SetReadDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("doq set read deadline: %w", err)
+	}
+
+	// DoQ requires the query ID to be 0 on the wire.
+	id := req.Id
+	req.Id = 0
+	packed, err := req.Pack()
+	req.Id = id
+	if err != nil {
+		return nil, fmt.Errorf("doq pack query: %w", err)
+	}
+
+	prefixed := make([]byte, 2+len(packed))
+	binary.BigEndian.PutUint16(prefixed, uint16(len(packed)))
+	copy(prefixed[2:], packed)
+
+	if _, err := stream.Write(prefixed); err != nil {
+		return nil, fmt.Errorf("doq write query: %w", err)
+	}
+	// Signal the server we're done sending on this stream.
+	if err := stream.Close(); err != nil {
+		return nil, fmt.Errorf("doq close write side: %w", err)
+	}
+
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(stream, lenBuf[:]); err != nil {
+		return nil, fmt.Errorf("doq read length prefix: %w", err)
+	}
+	replyLen := binary.BigEndian.Uint16(lenBuf[:])
+
+	replyBuf := make([]byte, replyLen)
+	if _, err := io.ReadFull(stream, replyBuf); err != nil {
+		return nil, fmt.Errorf("doq read reply: %w", err)
+	}
+
+	reply := new(dns.Msg)
+	if err := reply.Unpack(replyBuf); err != nil {
+		return nil, fmt.Errorf("doq unpack reply: %w", err)
+	}
+	reply.Id = id
+
+	return reply, nil
+}
+
+// Close tears down the underlying QUIC session.
+func (s *doqSession) Close() error {
+	return s.conn.CloseWithError(0, "")
+}
+
+// isDoQAddress reports whether addr names a DNS-over-QUIC upstream.
+func isDoQAddress(addr string) bool {
+	return strings.HasPrefix(addr, "quic://") || strings.HasPrefix(addr, "doq://")
+}
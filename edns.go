@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/miekg/dns"
+)
+
+// defaultEDNSBufferSize is used when --bufsize isn't given.
+const defaultEDNSBufferSize = 4096
+
+// ednsPadTarget is the size padded queries are padded up to, per the RFC
+// 7830 recommendation for encrypted transports. Queries already at or past
+// this size are not rounded up to a further multiple of it.
+const ednsPadTarget = 468
+
+// hasEDNSOptions reports whether any flag requires an OPT pseudo-record to
+// be attached to the query.
+func hasEDNSOptions() bool {
+	return opts.DNSSEC || opts.Nsid || opts.Subnet != "" || opts.Pad ||
+		opts.Cookie || opts.Keepalive || opts.Expire || opts.Bufsize != 0
+}
+
+// buildOPT assembles the OPT pseudo-record for a query from the EDNS(0)
+// flags, layering DO=1 on top when --dnssec is also given. serverCookie is
+// the server-echoed cookie learned from an earlier reply in this run, if
+// any; it's nil until one has been learned.
+func buildOPT(clientCookie, serverCookie []byte) *dns.OPT {
+	bufsize := opts.Bufsize
+	if bufsize == 0 {
+		bufsize = defaultEDNSBufferSize
+	}
+
+	o := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+	o.SetUDPSize(bufsize)
+	o.SetDo(opts.DNSSEC)
+
+	if opts.Nsid {
+		o.Option = append(o.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+	}
+
+	if opts.Subnet != "" {
+		o.Option = append(o.Option, parseClientSubnet(opts.Subnet))
+	}
+
+	if opts.Cookie {
+		o.Option = append(o.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: fmt.Sprintf("%x%x", clientCookie, serverCookie)})
+	}
+
+	if opts.Keepalive {
+		o.Option = append(o.Option, &dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE})
+	}
+
+	if opts.Expire {
+		o.Option = append(o.Option, &dns.EDNS0_EXPIRE{Code: dns.EDNS0EXPIRE})
+	}
+
+	// --pad is applied last, once the rest of the message is known, so it
+	// is handled separately by padEDNS0.
+
+	return o
+}
+
+// parseClientSubnet turns a --subnet value such as "1.2.3.0/24" or
+// "2001:db8::/56" into an EDNS0 client-subnet option.
+func parseClientSubnet(cidr string) *dns.EDNS0_SUBNET {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		fmt.Printf("%s is not a valid --subnet value\n", cidr)
+		os.Exit(1)
+	}
+
+	ones, _ := ipNet.Mask.Size()
+	family := uint16(1)
+	addr := ip.To4()
+	if addr == nil {
+		family = 2
+		addr = ip.To16()
+	}
+
+	return &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        family,
+		SourceNetmask: uint8(ones),
+		Address:       addr,
+	}
+}
+
+// newClientCookie generates the 8-byte random client cookie used by
+// --cookie. It's generated once per run and reused across qtypes so that a
+// server cookie, once learned, round-trips on subsequent queries.
+func newClientCookie() []byte {
+	cookie := make([]byte, 8)
+	if _, err := rand.Read(cookie); err != nil {
+		fmt.Println("failed to generate client cookie:", err)
+		os.Exit(1)
+	}
+	return cookie
+}
+
+// learnServerCookie extracts the server-echoed portion of a reply's EDNS
+// cookie (the bytes after the 8-byte client cookie), so it can be resent on
+// later queries in this run per RFC 7873 §5.3. It returns nil if the reply
+// carried no cookie, or an obviously malformed one.
+func learnServerCookie(msg *dns.Msg) []byte {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+
+	for _, o := range opt.Option {
+		cookie, ok := o.(*dns.EDNS0_COOKIE)
+		if !ok {
+			continue
+		}
+		raw, err := hex.DecodeString(cookie.Cookie)
+		if err != nil || len(raw) <= 8 {
+			return nil
+		}
+		return raw[8:]
+	}
+
+	return nil
+}
+
+// padEDNS0 adds RFC 7830 block-length padding to req's OPT record so the
+// packed message reaches ednsPadTarget bytes. Most useful over encrypted
+// transports, which would otherwise leak the query length on the wire.
+func padEDNS0(req *dns.Msg) {
+	opt := req.IsEdns0()
+	if opt == nil {
+		return
+	}
+
+	packed, err := req.Pack()
+	if err != nil {
+		return
+	}
+
+	const paddingOptHeader = 4 // option code + option length
+	padLen := ednsPadTarget - len(packed) - paddingOptHeader
+	if padLen < 0 {
+		padLen = 0
+	}
+
+	opt.Option = append(opt.Option, &dns.EDNS0_PADDING{Padding: make([]byte, padLen)})
+}
+
+// printOPT renders the OPT pseudo-section of a reply, colored like the
+// answer RR rows, so that NSID/subnet/cookie/keepalive/expire values that
+// came back are actually visible.
+func printOPT(msg *dns.Msg) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return
+	}
+
+	fmt.Printf("%s %s %s\n",
+		color("purple", ";; OPT"),
+		color("green", fmt.Sprintf("udp=%d", opt.UDPSize())),
+		color("magenta", fmt.Sprintf("do=%t", opt.Do())),
+	)
+
+	for _, o := range opt.Option {
+		switch v := o.(type) {
+		case *dns.EDNS0_NSID:
+			fmt.Printf("  %s %s\n", color("teal", "NSID"), v.String())
+		case *dns.EDNS0_SUBNET:
+			fmt.Printf("  %s %s/%d\n", color("teal", "SUBNET"), v.Address, v.SourceNetmask)
+		case *dns.EDNS0_COOKIE:
+			fmt.Printf("  %s %s\n", color("teal", "COOKIE"), v.Cookie)
+		case *dns.EDNS0_TCP_KEEPALIVE:
+			fmt.Printf("  %s %dms\n", color("teal", "KEEPALIVE"), v.Timeout*100)
+		case *dns.EDNS0_EXPIRE:
+			fmt.Printf("  %s %ds\n", color("teal", "EXPIRE"), v.Expire)
+		case *dns.EDNS0_PADDING:
+			fmt.Printf("  %s %d bytes\n", color("teal", "PADDING"), len(v.Padding))
+		default:
+			fmt.Printf("  %s\n", color("teal", o.String()))
+		}
+	}
+}
@@ -3,10 +3,10 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/AdguardTeam/dnsproxy/upstream"
 	"github.com/jessevdk/go-flags"
 	"github.com/miekg/dns"
 	log "github.com/sirupsen/logrus"
@@ -15,7 +15,7 @@ import (
 // Flags
 var opts struct {
 	Name      string   `short:"q" long:"qname" description:"Query name"`
-	Server    string   `short:"s" long:"server" description:"DNS server"`
+	Servers   []string `short:"s" long:"server" description:"DNS server (repeatable for multi-server queries)"`
 	Types     []string `short:"t" long:"type" description:"RR type"`
 	Reverse   bool     `short:"x" long:"reverse" description:"Reverse lookup"`
 	DNSSEC    bool     `short:"d" long:"dnssec" description:"Request DNSSEC"`
@@ -24,6 +24,17 @@ var opts struct {
 	OdohProxy string   `short:"p" long:"odoh-proxy" description:"ODoH proxy"`
 	Insecure  bool     `short:"i" long:"insecure" description:"Disable TLS certificate verification"`
 	Verbose   bool     `short:"v" long:"verbose" description:"Show verbose log messages"`
+	Nsid      bool     `long:"nsid" description:"Request the server's NSID"`
+	Subnet    string   `long:"subnet" description:"Send an EDNS client-subnet option, e.g. 1.2.3.0/24"`
+	Pad       bool     `long:"pad" description:"Pad the query to a fixed block length (RFC 7830)"`
+	Cookie    bool     `long:"cookie" description:"Send an EDNS cookie (RFC 7873)"`
+	Keepalive bool     `long:"keepalive" description:"Request an EDNS TCP keepalive"`
+	Expire    bool     `long:"expire" description:"Request the EDNS expire option"`
+	Bufsize   uint16   `long:"bufsize" description:"EDNS UDP buffer size (default 4096 once EDNS is in use)"`
+	Format    string   `long:"format" description:"Output format: pretty, raw, json, yaml" default:"pretty"`
+	Consensus bool     `long:"consensus" description:"Exit non-zero if multiple servers disagree on the answer"`
+	First     bool     `long:"first" description:"With multiple servers, return as soon as any one answers"`
+	Xfr       bool     `long:"xfr" description:"Perform a zone transfer (see also -t AXFR / -t IXFR=<serial>)"`
 }
 
 var version = "dev" // Set by build process
@@ -55,25 +66,68 @@ func main() {
 		os.Exit(1)
 	}
 
+	// -r/--raw is kept as an alias for --format raw
+	if opts.Raw {
+		opts.Format = "raw"
+	}
+	if opts.Format == "raw" {
+		opts.Raw = true
+	}
+	switch opts.Format {
+	case "pretty", "raw", "json", "yaml":
+	default:
+		fmt.Printf("%s is not a valid --format\n", opts.Format)
+		os.Exit(1)
+	}
+
 	// Enable debug logging in development releases
 	if //noinspection GoBoolExpressions
 	version == "devel" || opts.Verbose {
 		log.SetLevel(log.DebugLevel)
 	}
 
-	// Find a server by @ symbol if it isn't set by flag
-	if opts.Server == "" {
-		for _, arg := range os.Args {
-			if strings.HasPrefix(arg, "@") {
-				opts.Server = strings.TrimPrefix(arg, "@")
+	// Collect any bare @server arguments alongside -s/--server
+	for _, arg := range os.Args {
+		if strings.HasPrefix(arg, "@") {
+			opts.Servers = append(opts.Servers, strings.TrimPrefix(arg, "@"))
+		}
+	}
+
+	// -t AXFR / -t IXFR=<serial> select zone transfer mode instead of a
+	// regular RR type
+	var xfrSerial uint32
+	var filteredTypes []string
+	for _, rrType := range opts.Types {
+		switch upper := strings.ToUpper(rrType); {
+		case upper == "AXFR":
+			opts.Xfr = true
+		case strings.HasPrefix(upper, "IXFR"):
+			opts.Xfr = true
+			if _, serial, ok := strings.Cut(rrType, "="); ok {
+				n, err := strconv.ParseUint(serial, 10, 32)
+				if err != nil {
+					fmt.Printf("%s is not a valid IXFR serial\n", serial)
+					os.Exit(1)
+				}
+				xfrSerial = uint32(n)
 			}
+		default:
+			filteredTypes = append(filteredTypes, rrType)
 		}
 	}
+	opts.Types = filteredTypes
+
+	// A generic CLASSnnn token (RFC 3597) overrides -c/--chaos
+	var qclassOverride uint16
 
 	// Parse requested RR types
 	var rrTypes []uint16
 	for _, rrType := range opts.Types {
-		typeCode, ok := dns.StringToType[strings.ToUpper(rrType)]
+		if class, ok := parseGenericCode(rrType, "CLASS"); ok {
+			qclassOverride = class
+			continue
+		}
+		typeCode, ok := parseRRType(rrType)
 		if ok {
 			rrTypes = append(rrTypes, typeCode)
 		} else {
@@ -84,8 +138,16 @@ func main() {
 
 	// Add non-flag RR types
 	for _, arg := range os.Args {
-		rrType, ok := dns.StringToType[strings.ToUpper(arg)]
-		if ok {
+		if strings.ToUpper(arg) == "AXFR" {
+			opts.Xfr = true
+			continue
+		}
+		if class, ok := parseGenericCode(arg, "CLASS"); ok {
+			qclassOverride = class
+			continue
+		}
+		rrType, ok := parseRRType(arg)
+		if ok && rrType != dns.TypeAXFR && rrType != dns.TypeIXFR {
 			rrTypes = append(rrTypes, rrType)
 		}
 	}
@@ -101,7 +163,7 @@ func main() {
 	if opts.Verbose {
 		var rrTypeStrings []string
 		for _, rrType := range rrTypes {
-			rrTypeStrings = append(rrTypeStrings, dns.TypeToString[rrType])
+			rrTypeStrings = append(rrTypeStrings, typeToString(rrType))
 		}
 		log.Debugf("RR types: %+v", rrTypeStrings)
 	}
@@ -124,77 +186,179 @@ func main() {
 
 	log.Debugf("qname %s", opts.Name)
 
-	// Create the upstream server
-	u, err := upstream.AddressToUpstream(opts.Server, upstream.Options{
-		Timeout:            10 * time.Second,
-		InsecureSkipVerify: opts.Insecure,
-	})
+	// Load the OS's resolver configuration. It provides a fallback server
+	// when none was given on the command line, and the search-list/ndots
+	// rule applied to opts.Name below.
+	sysResolvConf, err := systemResolverConfig()
+	if err != nil {
+		log.Debugf("system resolver config unavailable: %s", err)
+		sysResolvConf = nil
+	}
+
+	if len(opts.Servers) == 0 {
+		if sysResolvConf == nil || len(sysResolvConf.Servers) == 0 {
+			log.Fatal("no server given and no system resolver could be found")
+		}
+		opts.Servers = append(opts.Servers, sysResolvConf.Servers[0])
+		log.Debugf("using system resolver %s", opts.Servers[0])
+	}
+
+	var qclass uint16
+	switch {
+	case qclassOverride != 0:
+		qclass = qclassOverride
+	case opts.Chaos:
+		qclass = dns.ClassCHAOS
+	default:
+		qclass = dns.ClassINET
+	}
+
+	if opts.Xfr {
+		os.Exit(runZoneTransfer(opts.Servers[0], opts.Insecure, xfrSerial))
+	}
+
+	// Fan out to every server concurrently and render a side-by-side diff
+	// when more than one was given.
+	if len(opts.Servers) > 1 {
+		os.Exit(runMultiServer(rrTypes, qclass))
+	}
+
+	// Create the upstream server. DoQ gets its own long-lived session so
+	// that the QUIC connection is reused across qtypes, and DNSCrypt its own
+	// session so that one certificate handshake serves every qtype;
+	// everything else still goes through dnsproxy's upstream.Upstream.
+	queryFn, serverAddress, transport, closer, err := newTransport(opts.Servers[0], opts.Insecure)
 	if err != nil {
 		log.Fatalf("cannot create upstream %v", err)
 	}
+	if closer != nil {
+		defer closer()
+	}
+	if opts.OdohProxy != "" {
+		// ODoH has never had a working client in this tree; fail fast here
+		// rather than dispatching to a query function that doesn't exist.
+		log.Fatal("--odoh-proxy is not currently supported")
+	}
 
-	log.Debugf("using server %s\n", u.Address())
+	log.Debugf("using server %s\n", serverAddress)
+
+	// Promote an unqualified name through the search list/ndots rule
+	// before issuing any real queries. Reverse lookups are left alone: their
+	// name is already fully qualified.
+	if !opts.Reverse {
+		opts.Name = resolveSearchName(queryFn, opts.Name, rrTypes[0], qclass, sysResolvConf)
+	}
 
 	var replies []*dns.Msg
 	queryStartTime := time.Now()
 
+	structured := isStructuredFormat(opts.Format)
+	doc := &outputDocument{
+		Question:  dns.Fqdn(opts.Name),
+		Server:    serverAddress,
+		Transport: transport,
+	}
+
+	// clientCookie is generated once and reused across qtypes; serverCookie
+	// is filled in once the server echoes one back, so it round-trips on
+	// subsequent queries in this run.
+	var clientCookie, serverCookie []byte
+	if opts.Cookie {
+		clientCookie = newClientCookie()
+	}
+
 	// Query for each requested RR type
 	for _, qType := range rrTypes {
 		req := dns.Msg{}
 
-		// Create the DNS question
-		if opts.DNSSEC {
-			req.SetEdns0(4096, true)
+		// Attach an OPT pseudo-record if any EDNS(0) flag was given
+		if hasEDNSOptions() {
+			req.Extra = append(req.Extra, buildOPT(clientCookie, serverCookie))
 		}
 
-		// Set QCLASS
-		var class uint16
-		if opts.Chaos {
-			class = dns.ClassCHAOS
-		} else {
-			class = dns.ClassINET
-		}
 		req.RecursionDesired = true
 		req.Question = []dns.Question{{
 			Name:   dns.Fqdn(opts.Name),
 			Qtype:  qType,
-			Qclass: class,
+			Qclass: qclass,
 		}}
 
-		var reply *dns.Msg
-		// Use upstream exchange if no ODoH proxy is configured
-		if opts.OdohProxy == "" {
-			// Send question to server
-			reply, err = u.Exchange(&req)
-		} else {
-			log.Debugf("using ODoH proxy %s", opts.OdohProxy)
-			reply, err = odohQuery(req, opts.OdohProxy, opts.Server)
+		if opts.Pad {
+			padEDNS0(&req)
 		}
+
+		qStart := time.Now()
+		reply, err := queryFn(&req)
+		rtt := time.Since(qStart)
+
 		if err != nil {
-			log.Fatalf("upstream query: %s", err)
+			// Structured output must always produce a document, even for
+			// SERVFAIL/timeout/TLS failures; every other format keeps the
+			// established fail-fast behavior.
+			if !structured {
+				log.Fatalf("upstream query: %s", err)
+			}
+			doc.Queries = append(doc.Queries, queryResult{
+				Type:  typeToString(qType),
+				RTT:   rtt.Round(time.Microsecond).String(),
+				Error: err.Error(),
+			})
+			continue
 		}
 
 		replies = append(replies, reply)
 
+		if opts.Cookie {
+			if learned := learnServerCookie(reply); learned != nil {
+				serverCookie = learned
+			}
+		}
+
+		if structured {
+			result := queryResult{
+				Type: typeToString(qType),
+				RTT:  rtt.Round(time.Microsecond).String(),
+				OPT:  decodeOPT(reply),
+			}
+			if reply.Rcode != dns.RcodeSuccess {
+				result.Error = dns.RcodeToString[reply.Rcode]
+			}
+			for _, answer := range reply.Answer {
+				result.Answers = append(result.Answers, decodeRR(answer))
+			}
+			doc.Queries = append(doc.Queries, result)
+			continue
+		}
+
+		if !opts.Raw && hasEDNSOptions() {
+			printOPT(reply)
+		}
+
 		// Print answers
 		for _, answer := range reply.Answer {
 			if opts.Raw {
 				fmt.Println(answer.String())
 			} else {
 				hdr := answer.Header()
+				typeName := typeToString(hdr.Rrtype)
 				fmt.Printf("%s %s %s %s\n",
 					color("purple", hdr.Name),
 					color("green", time.Duration(hdr.Ttl)*time.Second),
-					color("magenta", dns.TypeToString[hdr.Rrtype]),
-					strings.TrimSpace(strings.Join(strings.Split(answer.String(), dns.TypeToString[hdr.Rrtype])[1:], "")),
+					color("magenta", typeName),
+					strings.TrimSpace(strings.Join(strings.Split(answer.String(), typeName)[1:], "")),
 				)
 			}
 		}
 
 	}
 
+	if structured {
+		printDocument(doc, opts.Format)
+		return
+	}
+
 	queryTime := time.Now().Sub(queryStartTime)
 	if opts.Raw {
-		fmt.Printf(";; Received %d replies from %s in %s\n", len(replies), u.Address(), queryTime.Round(time.Millisecond))
+		fmt.Printf(";; Received %d replies from %s in %s\n", len(replies), serverAddress, queryTime.Round(time.Millisecond))
 	}
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+// serverTransport pairs a configured query function with the server
+// address and transport name used to reach it.
+type serverTransport struct {
+	address string
+	name    string
+	queryFn func(*dns.Msg) (*dns.Msg, error)
+	closer  func() error
+}
+
+// serverAnswer is one server's result for a single qtype.
+type serverAnswer struct {
+	server string
+	rtt    time.Duration
+	answer string // canonicalized answer RRset, used to diff servers
+	reply  *dns.Msg
+	err    error
+}
+
+// runMultiServer fans every qtype out to every configured server
+// concurrently and prints a side-by-side comparison table. It returns the
+// process exit code: non-zero if --consensus is set and servers disagree.
+func runMultiServer(rrTypes []uint16, qclass uint16) int {
+	var transports []*serverTransport
+	for _, server := range opts.Servers {
+		queryFn, address, name, closer, err := newTransport(server, opts.Insecure)
+		if err != nil {
+			log.Errorf("skipping %s: %s", server, err)
+			continue
+		}
+		transports = append(transports, &serverTransport{address: address, name: name, queryFn: queryFn, closer: closer})
+	}
+	for _, t := range transports {
+		if t.closer != nil {
+			defer t.closer()
+		}
+	}
+	if len(transports) == 0 {
+		log.Fatal("no usable server")
+	}
+
+	disagreement := false
+
+	// Generated once, the same way main.go does for the single-server case,
+	// so every server in this fan-out gets a real 8-byte client cookie
+	// instead of an empty one.
+	var clientCookie []byte
+	if opts.Cookie {
+		clientCookie = newClientCookie()
+	}
+
+	for _, qType := range rrTypes {
+		req := dns.Msg{}
+		req.RecursionDesired = true
+		req.Question = []dns.Question{{Name: dns.Fqdn(opts.Name), Qtype: qType, Qclass: qclass}}
+		if hasEDNSOptions() {
+			req.Extra = append(req.Extra, buildOPT(clientCookie, nil))
+		}
+
+		answers := queryAllServers(transports, req)
+		plurality := pluralityAnswer(answers)
+
+		fmt.Printf("%s %s\n", color("purple", ";;"), color("magenta", typeToString(qType)))
+
+		for _, a := range answers {
+			if a.reply == nil && a.err == nil {
+				continue // --first returned before this server answered
+			}
+			if a.err != nil {
+				fmt.Printf("  %-24s %s\n", a.server, color("red", "error: "+a.err.Error()))
+				continue
+			}
+
+			line := fmt.Sprintf("  %-24s %8s  %s", a.server, a.rtt.Round(time.Millisecond), a.answer)
+			if a.answer != plurality {
+				disagreement = true
+				fmt.Println(color("red", line))
+			} else {
+				fmt.Println(color("green", line))
+			}
+		}
+	}
+
+	if opts.Consensus && disagreement {
+		return 1
+	}
+	return 0
+}
+
+// queryAllServers sends req to every transport concurrently, honoring
+// --first by returning as soon as the first reply (success or error)
+// arrives rather than waiting on every server.
+func queryAllServers(transports []*serverTransport, req dns.Msg) []serverAnswer {
+	type indexed struct {
+		i int
+		a serverAnswer
+	}
+	results := make([]serverAnswer, len(transports))
+	ch := make(chan indexed, len(transports))
+
+	for i, t := range transports {
+		go func(i int, t *serverTransport) {
+			reqCopy := req // each transport gets its own copy; exchange mutates req.Id
+			start := time.Now()
+			reply, err := t.queryFn(&reqCopy)
+			a := serverAnswer{server: t.address, rtt: time.Since(start), reply: reply, err: err}
+			if err == nil {
+				a.answer = summarizeAnswer(reply)
+			}
+			ch <- indexed{i, a}
+		}(i, t)
+	}
+
+	for n := 0; n < len(transports); n++ {
+		r := <-ch
+		results[r.i] = r.a
+		if opts.First {
+			break
+		}
+	}
+
+	return results
+}
+
+// summarizeAnswer canonicalizes a reply's answer RRset into a single,
+// order-independent string so that two servers' answers can be diffed.
+func summarizeAnswer(reply *dns.Msg) string {
+	if len(reply.Answer) == 0 {
+		return fmt.Sprintf("(%s, no answers)", dns.RcodeToString[reply.Rcode])
+	}
+
+	lines := make([]string, 0, len(reply.Answer))
+	for _, rr := range reply.Answer {
+		lines = append(lines, rr.String())
+	}
+	sort.Strings(lines)
+
+	return strings.Join(lines, " | ")
+}
+
+// pluralityAnswer returns the answer string shared by the most servers, so
+// outliers can be highlighted against it.
+func pluralityAnswer(answers []serverAnswer) string {
+	counts := map[string]int{}
+	for _, a := range answers {
+		if a.err != nil || a.reply == nil {
+			continue // erroring, or --first returned before this server answered
+		}
+		counts[a.answer]++
+	}
+
+	var best string
+	bestCount := -1
+	for answer, count := range counts {
+		if count > bestCount {
+			best, bestCount = answer, count
+		}
+	}
+
+	return best
+}
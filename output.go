@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// outputDocument is the root of the structured --format json/yaml document:
+// one per invocation, covering every qtype that was queried.
+type outputDocument struct {
+	Question  string        `json:"question" yaml:"question"`
+	Server    string        `json:"server" yaml:"server"`
+	Transport string        `json:"transport" yaml:"transport"`
+	Queries   []queryResult `json:"queries" yaml:"queries"`
+}
+
+// queryResult is the outcome of a single qtype lookup.
+type queryResult struct {
+	Type    string     `json:"type" yaml:"type"`
+	RTT     string     `json:"rtt" yaml:"rtt"`
+	Answers []rrRecord `json:"answers" yaml:"answers"`
+	OPT     *optRecord `json:"opt,omitempty" yaml:"opt,omitempty"`
+	Error   string     `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// rrRecord is one answer RR, decoded into a stable, type-specific shape.
+type rrRecord struct {
+	Name  string                 `json:"name" yaml:"name"`
+	TTL   uint32                 `json:"ttl" yaml:"ttl"`
+	Class string                 `json:"class" yaml:"class"`
+	Type  string                 `json:"type" yaml:"type"`
+	Data  map[string]interface{} `json:"data" yaml:"data"`
+}
+
+// optRecord is the decoded EDNS(0) OPT pseudo-section of a reply.
+type optRecord struct {
+	UDPSize uint16                   `json:"udp_size" yaml:"udp_size"`
+	DO      bool                     `json:"do" yaml:"do"`
+	Options []map[string]interface{} `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// isStructuredFormat reports whether format serializes the whole batch as
+// one document, as opposed to printing incrementally.
+func isStructuredFormat(format string) bool {
+	return format == "json" || format == "yaml"
+}
+
+// decodeRR turns an answer RR into the stable {name, ttl, class, type,
+// data} shape used by --format json/yaml.
+func decodeRR(rr dns.RR) rrRecord {
+	hdr := rr.Header()
+	rec := rrRecord{
+		Name:  hdr.Name,
+		TTL:   hdr.Ttl,
+		Class: dns.ClassToString[hdr.Class],
+		Type:  typeToString(hdr.Rrtype),
+		Data:  map[string]interface{}{},
+	}
+
+	switch v := rr.(type) {
+	case *dns.A:
+		rec.Data["ip"] = v.A.String()
+	case *dns.AAAA:
+		rec.Data["ip"] = v.AAAA.String()
+	case *dns.CNAME:
+		rec.Data["target"] = v.Target
+	case *dns.NS:
+		rec.Data["ns"] = v.Ns
+	case *dns.PTR:
+		rec.Data["ptr"] = v.Ptr
+	case *dns.TXT:
+		rec.Data["txt"] = v.Txt
+	case *dns.MX:
+		rec.Data["pref"] = v.Preference
+		rec.Data["exchange"] = v.Mx
+	case *dns.SRV:
+		rec.Data["priority"] = v.Priority
+		rec.Data["weight"] = v.Weight
+		rec.Data["port"] = v.Port
+		rec.Data["target"] = v.Target
+	case *dns.SOA:
+		rec.Data["ns"] = v.Ns
+		rec.Data["mbox"] = v.Mbox
+		rec.Data["serial"] = v.Serial
+		rec.Data["refresh"] = v.Refresh
+		rec.Data["retry"] = v.Retry
+		rec.Data["expire"] = v.Expire
+		rec.Data["minttl"] = v.Minttl
+	case *dns.SVCB:
+		rec.Data["priority"] = v.Priority
+		rec.Data["target"] = v.Target
+		rec.Data["params"] = decodeSvcParams(v.Value)
+	case *dns.HTTPS:
+		rec.Data["priority"] = v.Priority
+		rec.Data["target"] = v.Target
+		rec.Data["params"] = decodeSvcParams(v.Value)
+	default:
+		rec.Data["rdata"] = rr.String()
+	}
+
+	return rec
+}
+
+// decodeSvcParams flattens SVCB/HTTPS SvcParamKeys into a {name: value} map.
+func decodeSvcParams(params []dns.SVCBKeyValue) map[string]string {
+	out := map[string]string{}
+	for _, p := range params {
+		out[p.Key().String()] = p.String()
+	}
+	return out
+}
+
+// decodeOPT turns a reply's EDNS(0) OPT pseudo-record into optRecord, or
+// nil if the reply carried none.
+func decodeOPT(msg *dns.Msg) *optRecord {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+
+	rec := &optRecord{UDPSize: opt.UDPSize(), DO: opt.Do()}
+	for _, o := range opt.Option {
+		rec.Options = append(rec.Options, map[string]interface{}{
+			"code":  ednsOptionCodeToString(o.Option()),
+			"value": o.String(),
+		})
+	}
+
+	return rec
+}
+
+// ednsOptionCodeToString names an EDNS(0) option code, falling back to the
+// generic OPTnnn form (mirroring typeToString's TYPEnnn fallback) for codes
+// this build doesn't otherwise recognize.
+func ednsOptionCodeToString(code uint16) string {
+	switch code {
+	case dns.EDNS0NSID:
+		return "NSID"
+	case dns.EDNS0SUBNET:
+		return "SUBNET"
+	case dns.EDNS0EXPIRE:
+		return "EXPIRE"
+	case dns.EDNS0COOKIE:
+		return "COOKIE"
+	case dns.EDNS0TCPKEEPALIVE:
+		return "KEEPALIVE"
+	case dns.EDNS0PADDING:
+		return "PADDING"
+	case dns.EDNS0EDE:
+		return "EDE"
+	default:
+		return fmt.Sprintf("OPT%d", code)
+	}
+}
+
+// printDocument serializes doc as JSON or YAML and writes it to stdout.
+func printDocument(doc *outputDocument, format string) {
+	var out []byte
+	var err error
+
+	switch format {
+	case "json":
+		out, err = json.MarshalIndent(doc, "", "  ")
+	case "yaml":
+		out, err = yaml.Marshal(doc)
+	default:
+		err = fmt.Errorf("unknown structured format %q", format)
+	}
+	if err != nil {
+		fmt.Println("failed to encode output:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(string(out))
+}
+
+// typeToString returns the friendly RR type name, falling back to the
+// RFC 3597 TYPEnnn form for types miekg/dns doesn't know by name.
+func typeToString(rrType uint16) string {
+	if name, ok := dns.TypeToString[rrType]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", rrType)
+}
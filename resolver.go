@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+// resolverConfig is the OS's configured DNS resolution state: the
+// nameservers to query plus the traditional search-list/ndots rule for
+// promoting unqualified names.
+type resolverConfig struct {
+	Servers []string
+	Search  []string
+	Ndots   int
+}
+
+// defaultNdots is used when the OS configuration doesn't specify one.
+const defaultNdots = 1
+
+// resolveSearchName applies the ndots/search-list rule: an unqualified
+// name with fewer dots than Ndots is tried against each search suffix (in
+// order) until one yields a non-NXDOMAIN answer; otherwise the bare name
+// is queried as-is. queryFn is used to probe each candidate with qType.
+func resolveSearchName(queryFn func(*dns.Msg) (*dns.Msg, error), name string, qType, class uint16, cfg *resolverConfig) string {
+	if cfg == nil || len(cfg.Search) == 0 || strings.HasSuffix(name, ".") {
+		return dns.Fqdn(name)
+	}
+
+	ndots := cfg.Ndots
+	if ndots <= 0 {
+		ndots = defaultNdots
+	}
+	if strings.Count(name, ".") >= ndots {
+		return dns.Fqdn(name)
+	}
+
+	for _, suffix := range cfg.Search {
+		candidate := dns.Fqdn(name + "." + suffix)
+
+		req := new(dns.Msg)
+		req.RecursionDesired = true
+		req.Question = []dns.Question{{Name: candidate, Qtype: qType, Qclass: class}}
+
+		reply, err := queryFn(req)
+		if err != nil {
+			continue
+		}
+		if reply.Rcode != dns.RcodeNameError {
+			log.Debugf("resolved %q via search suffix %q", name, suffix)
+			return candidate
+		}
+	}
+
+	log.Debugf("no search suffix resolved %q, querying bare name", name)
+	return dns.Fqdn(name)
+}
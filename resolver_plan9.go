@@ -0,0 +1,41 @@
+//go:build plan9
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// ndbPath is where Plan 9 keeps its network database.
+const ndbPath = "/net/ndb"
+
+// systemResolverConfig reads the dns= entries of /net/ndb, Plan 9's
+// network configuration database.
+func systemResolverConfig() (*resolverConfig, error) {
+	f, err := os.Open(ndbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg := &resolverConfig{Ndots: defaultNdots}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		for _, attr := range strings.Fields(scanner.Text()) {
+			if server, ok := strings.CutPrefix(attr, "dns="); ok {
+				cfg.Servers = append(cfg.Servers, server)
+			}
+			if domain, ok := strings.CutPrefix(attr, "dnsdomain="); ok {
+				cfg.Search = append(cfg.Search, domain)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// fakeReplies drives resolveSearchName's queryFn: it returns a NXDOMAIN
+// reply for every question name not listed in ok, and a NOERROR reply
+// otherwise, so tests can assert which search suffix (if any) "resolved".
+func fakeReplies(ok map[string]bool) func(*dns.Msg) (*dns.Msg, error) {
+	return func(req *dns.Msg) (*dns.Msg, error) {
+		reply := new(dns.Msg)
+		reply.SetReply(req)
+		if ok[req.Question[0].Name] {
+			reply.Rcode = dns.RcodeSuccess
+		} else {
+			reply.Rcode = dns.RcodeNameError
+		}
+		return reply, nil
+	}
+}
+
+func TestResolveSearchName(t *testing.T) {
+	t.Run("no config falls back to bare fqdn", func(t *testing.T) {
+		got := resolveSearchName(fakeReplies(nil), "host", dns.TypeA, dns.ClassINET, nil)
+		if got != "host." {
+			t.Errorf("got %q, want %q", got, "host.")
+		}
+	})
+
+	t.Run("already qualified name is never promoted", func(t *testing.T) {
+		cfg := &resolverConfig{Search: []string{"example.com"}, Ndots: 1}
+		got := resolveSearchName(fakeReplies(nil), "host.", dns.TypeA, dns.ClassINET, cfg)
+		if got != "host." {
+			t.Errorf("got %q, want %q", got, "host.")
+		}
+	})
+
+	t.Run("name with enough dots is queried as-is", func(t *testing.T) {
+		cfg := &resolverConfig{Search: []string{"example.com"}, Ndots: 1}
+		got := resolveSearchName(fakeReplies(nil), "host.internal", dns.TypeA, dns.ClassINET, cfg)
+		if got != "host.internal." {
+			t.Errorf("got %q, want %q", got, "host.internal.")
+		}
+	})
+
+	t.Run("ndots zero falls back to defaultNdots", func(t *testing.T) {
+		cfg := &resolverConfig{Search: []string{"example.com"}, Ndots: 0}
+		got := resolveSearchName(fakeReplies(map[string]bool{"host.example.com.": true}), "host", dns.TypeA, dns.ClassINET, cfg)
+		if got != "host.example.com." {
+			t.Errorf("got %q, want %q", got, "host.example.com.")
+		}
+	})
+
+	t.Run("first matching suffix wins", func(t *testing.T) {
+		cfg := &resolverConfig{Search: []string{"corp.example", "example.com"}, Ndots: 1}
+		got := resolveSearchName(fakeReplies(map[string]bool{"host.example.com.": true}), "host", dns.TypeA, dns.ClassINET, cfg)
+		if got != "host.example.com." {
+			t.Errorf("got %q, want %q", got, "host.example.com.")
+		}
+	})
+
+	t.Run("earlier suffix takes priority over a later one that also matches", func(t *testing.T) {
+		cfg := &resolverConfig{Search: []string{"corp.example", "example.com"}, Ndots: 1}
+		ok := map[string]bool{"host.corp.example.": true, "host.example.com.": true}
+		got := resolveSearchName(fakeReplies(ok), "host", dns.TypeA, dns.ClassINET, cfg)
+		if got != "host.corp.example." {
+			t.Errorf("got %q, want %q", got, "host.corp.example.")
+		}
+	})
+
+	t.Run("no suffix resolves, falls back to bare name", func(t *testing.T) {
+		cfg := &resolverConfig{Search: []string{"corp.example", "example.com"}, Ndots: 1}
+		got := resolveSearchName(fakeReplies(nil), "host", dns.TypeA, dns.ClassINET, cfg)
+		if got != "host." {
+			t.Errorf("got %q, want %q", got, "host.")
+		}
+	})
+
+	t.Run("query error on a suffix is skipped, not fatal", func(t *testing.T) {
+		cfg := &resolverConfig{Search: []string{"corp.example", "example.com"}, Ndots: 1}
+		calls := 0
+		queryFn := func(req *dns.Msg) (*dns.Msg, error) {
+			calls++
+			if req.Question[0].Name == "host.corp.example." {
+				return nil, errors.New("timeout")
+			}
+			reply := new(dns.Msg)
+			reply.SetReply(req)
+			reply.Rcode = dns.RcodeSuccess
+			return reply, nil
+		}
+
+		got := resolveSearchName(queryFn, "host", dns.TypeA, dns.ClassINET, cfg)
+		if got != "host.example.com." {
+			t.Errorf("got %q, want %q", got, "host.example.com.")
+		}
+		if calls != 2 {
+			t.Errorf("calls = %d, want 2", calls)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// resolvConfPath is where Unix systems keep their resolver configuration.
+const resolvConfPath = "/etc/resolv.conf"
+
+// systemResolverConfig parses /etc/resolv.conf for nameserver, search, and
+// options ndots directives, per resolv.conf(5).
+func systemResolverConfig() (*resolverConfig, error) {
+	f, err := os.Open(resolvConfPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg := &resolverConfig{Ndots: defaultNdots}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "nameserver":
+			cfg.Servers = append(cfg.Servers, fields[1])
+		case "search", "domain":
+			cfg.Search = append(cfg.Search, fields[1:]...)
+		case "options":
+			for _, opt := range fields[1:] {
+				if n, ok := strings.CutPrefix(opt, "ndots:"); ok {
+					if v, err := strconv.Atoi(n); err == nil {
+						cfg.Ndots = v
+					}
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
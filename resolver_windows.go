@@ -0,0 +1,131 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// systemResolverConfig enumerates each network adapter's configured DNS
+// servers via GetAdaptersAddresses, falling back to the registry when the
+// API call fails (seen on some locked-down or very old Windows hosts).
+func systemResolverConfig() (*resolverConfig, error) {
+	cfg := &resolverConfig{Ndots: defaultNdots}
+
+	servers, err := adaptersDNSServers()
+	if err != nil {
+		servers, err = registryDNSServers()
+		if err != nil {
+			return nil, fmt.Errorf("no DNS configuration found: %w", err)
+		}
+	}
+	cfg.Servers = servers
+
+	return cfg, nil
+}
+
+// adaptersDNSServers calls GetAdaptersAddresses and collects the DNS
+// server addresses of every up, non-loopback adapter.
+func adaptersDNSServers() ([]string, error) {
+	var size uint32 = 15000
+	var buf []byte
+
+	for i := 0; i < 3; i++ {
+		buf = make([]byte, size)
+		aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0]))
+		err := windows.GetAdaptersAddresses(
+			windows.AF_UNSPEC,
+			windows.GAA_FLAG_SKIP_ANYCAST|windows.GAA_FLAG_SKIP_MULTICAST,
+			0, aa, &size,
+		)
+		if err == nil {
+			break
+		}
+		if err != windows.ERROR_BUFFER_OVERFLOW || i == 2 {
+			return nil, err
+		}
+	}
+
+	var servers []string
+	for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); aa != nil; aa = aa.Next {
+		if aa.OperStatus != windows.IfOperStatusUp || aa.IfType == windows.IF_TYPE_SOFTWARE_LOOPBACK {
+			continue
+		}
+		for dns := aa.FirstDnsServerAddress; dns != nil; dns = dns.Next {
+			if ip := dns.Address.IP(); ip != nil {
+				servers = append(servers, ip.String())
+			}
+		}
+	}
+
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no adapters returned a DNS server")
+	}
+
+	return servers, nil
+}
+
+// registryDNSServers falls back to reading the per-interface NameServer
+// value under Tcpip\Parameters\Interfaces when the adapter API is
+// unavailable.
+func registryDNSServers() ([]string, error) {
+	const base = `SYSTEM\CurrentControlSet\Services\Tcpip\Parameters\Interfaces`
+
+	root, err := registry.OpenKey(registry.LOCAL_MACHINE, base, registry.READ)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	names, err := root.ReadSubKeyNames(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []string
+	for _, name := range names {
+		key, err := registry.OpenKey(registry.LOCAL_MACHINE, base+`\`+name, registry.READ)
+		if err != nil {
+			continue
+		}
+
+		ns, _, err := key.GetStringValue("NameServer")
+		key.Close()
+		if err != nil || ns == "" {
+			continue
+		}
+
+		for _, s := range splitRegistryList(ns) {
+			servers = append(servers, s)
+		}
+	}
+
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no NameServer values found in registry")
+	}
+
+	return servers, nil
+}
+
+// splitRegistryList splits the comma-separated server list Windows stores
+// in the NameServer registry value.
+func splitRegistryList(s string) []string {
+	var out []string
+	start := 0
+	for i, r := range s {
+		if r == ',' || r == ' ' {
+			if i > start {
+				out = append(out, s[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		out = append(out, s[start:])
+	}
+	return out
+}
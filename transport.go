@@ -0,0 +1,41 @@
+package main
+
+import (
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/miekg/dns"
+)
+
+// queryTimeout is the per-query deadline used for every transport.
+const queryTimeout = 10 * time.Second
+
+// newTransport builds the query function and display metadata for a
+// single server address, selecting DoQ, DNSCrypt, or dnsproxy's generic
+// upstream.Upstream as appropriate. Each call returns its own independent
+// session/state, so separate transports are safe to use concurrently.
+func newTransport(server string, insecure bool) (queryFn func(*dns.Msg) (*dns.Msg, error), address, transportName string, closer func() error, err error) {
+	switch {
+	case isDoQAddress(server):
+		sess, err := newDoQSession(server, insecure, queryTimeout)
+		if err != nil {
+			return nil, "", "", nil, err
+		}
+		return sess.exchange, server, "doq", sess.Close, nil
+	case isDNSCryptAddress(server):
+		sess, err := newDNSCryptSession(server, queryTimeout)
+		if err != nil {
+			return nil, "", "", nil, err
+		}
+		return sess.exchange, server, "dnscrypt", nil, nil
+	default:
+		u, err := upstream.AddressToUpstream(server, &upstream.Options{
+			Timeout:            queryTimeout,
+			InsecureSkipVerify: insecure,
+		})
+		if err != nil {
+			return nil, "", "", nil, err
+		}
+		return u.Exchange, u.Address(), "upstream", nil, nil
+	}
+}
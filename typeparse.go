@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// parseRRType resolves a type token to its numeric RR type, accepting both
+// the names miekg/dns knows (A, MX, ...) and the RFC 3597 generic TYPEnnn
+// form for types it doesn't have a name for yet.
+func parseRRType(s string) (uint16, bool) {
+	if t, ok := dns.StringToType[strings.ToUpper(s)]; ok {
+		return t, true
+	}
+	return parseGenericCode(s, "TYPE")
+}
+
+// parseGenericCode parses the RFC 3597 TYPEnnn/CLASSnnn generic
+// presentation, e.g. parseGenericCode("TYPE65", "TYPE") -> (65, true).
+func parseGenericCode(s, prefix string) (uint16, bool) {
+	upper := strings.ToUpper(s)
+	if !strings.HasPrefix(upper, prefix) {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(s[len(prefix):])
+	if err != nil || n < 0 || n > 0xffff {
+		return 0, false
+	}
+
+	return uint16(n), true
+}
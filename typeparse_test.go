@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestParseRRType(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   uint16
+		wantOk bool
+	}{
+		{"A", 1, true},
+		{"a", 1, true},
+		{"MX", 15, true},
+		{"AAAA", 28, true},
+		{"TYPE65", 65, true},
+		{"type65", 65, true},
+		{"TYPE0", 0, true},
+		{"TYPE65535", 65535, true},
+		{"TYPE65536", 0, false},
+		{"TYPE-1", 0, false},
+		{"BOGUS", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseRRType(tt.in)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("parseRRType(%q) = (%d, %v), want (%d, %v)", tt.in, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestParseGenericCode(t *testing.T) {
+	tests := []struct {
+		in     string
+		prefix string
+		want   uint16
+		wantOk bool
+	}{
+		{"TYPE65", "TYPE", 65, true},
+		{"type65", "TYPE", 65, true},
+		{"CLASS32", "CLASS", 32, true},
+		{"CLASS0", "CLASS", 0, true},
+		{"CLASS65535", "CLASS", 65535, true},
+		{"CLASS65536", "CLASS", 0, false},
+		{"CLASS-1", "CLASS", 0, false},
+		{"CLASSfoo", "CLASS", 0, false},
+		{"TYPE65", "CLASS", 0, false},
+		{"IN", "CLASS", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseGenericCode(tt.in, tt.prefix)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("parseGenericCode(%q, %q) = (%d, %v), want (%d, %v)", tt.in, tt.prefix, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// runZoneTransfer drives an AXFR, or an IXFR when serial is non-zero,
+// against server and streams each RR as it arrives. It returns the
+// process exit code.
+func runZoneTransfer(server string, insecure bool, serial uint32) int {
+	address, useTLS := xfrDialAddress(server)
+	zone := dns.Fqdn(opts.Name)
+
+	qType := uint16(dns.TypeAXFR)
+	if serial != 0 {
+		qType = dns.TypeIXFR
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion(zone, qType)
+	if qType == dns.TypeIXFR {
+		req.Ns = append(req.Ns, &dns.SOA{
+			Hdr:    dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET},
+			Serial: serial,
+		})
+	}
+
+	t := &dns.Transfer{DialTimeout: queryTimeout, ReadTimeout: queryTimeout}
+	if useTLS {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: queryTimeout}, "tcp", address, &tls.Config{InsecureSkipVerify: insecure})
+		if err != nil {
+			log.Fatalf("upstream query: %s", err)
+		}
+		t.Conn = &dns.Conn{Conn: conn}
+	}
+
+	env, err := t.In(req, address)
+	if err != nil {
+		log.Fatalf("upstream query: %s", err)
+	}
+
+	var envelopes, totalRRs, totalBytes int
+	var soaCount int
+	start := time.Now()
+
+	for e := range env {
+		if e.Error != nil {
+			log.Fatalf("upstream query: %s", e.Error)
+		}
+
+		envelopes++
+		totalRRs += len(e.RR)
+		for _, rr := range e.RR {
+			totalBytes += dns.Len(rr)
+			if rr.Header().Rrtype == dns.TypeSOA {
+				soaCount++
+			}
+			printXfrRR(rr)
+		}
+	}
+
+	// An IXFR response carrying only the two boundary SOA records (rather
+	// than alternating SOA-delimited delete/add sequences) means the
+	// server fell back to a full zone transfer, per RFC 1995 §4.
+	if qType == dns.TypeIXFR && soaCount == 2 {
+		log.Debugf("server answered IXFR with a full zone transfer")
+	}
+
+	if !isStructuredFormat(opts.Format) {
+		fmt.Printf(";; %d envelopes, %d records, %d bytes in %s\n",
+			envelopes, totalRRs, totalBytes, time.Since(start).Round(time.Millisecond))
+	}
+
+	return 0
+}
+
+// xfrDialAddress strips any tcp://, tls:// scheme from server and appends
+// the default port (53, or 853 for tls://) when none is given, returning
+// whether the transfer should run over TLS.
+func xfrDialAddress(server string) (address string, useTLS bool) {
+	switch {
+	case strings.HasPrefix(server, "tls://"):
+		server, useTLS = strings.TrimPrefix(server, "tls://"), true
+	case strings.HasPrefix(server, "tcp://"):
+		server = strings.TrimPrefix(server, "tcp://")
+	}
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		port := "53"
+		if useTLS {
+			port = "853"
+		}
+		server = net.JoinHostPort(server, port)
+	}
+
+	return server, useTLS
+}
+
+// printXfrRR prints a single transferred RR, honoring --format.
+func printXfrRR(rr dns.RR) {
+	switch opts.Format {
+	case "json":
+		out, err := json.Marshal(decodeRR(rr))
+		if err == nil {
+			fmt.Println(string(out))
+		}
+	case "yaml":
+		out, err := yaml.Marshal(decodeRR(rr))
+		if err == nil {
+			fmt.Print("---\n" + string(out))
+		}
+	case "raw":
+		fmt.Println(rr.String())
+	default:
+		hdr := rr.Header()
+		typeName := typeToString(hdr.Rrtype)
+		fmt.Printf("%s %s %s %s\n",
+			color("purple", hdr.Name),
+			color("green", time.Duration(hdr.Ttl)*time.Second),
+			color("magenta", typeName),
+			strings.TrimSpace(strings.Join(strings.Split(rr.String(), typeName)[1:], "")),
+		)
+	}
+}